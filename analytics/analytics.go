@@ -0,0 +1,266 @@
+// Package analytics records short-link redirects (clicks) without
+// slowing down the redirect itself, and serves aggregate stats back out.
+// Events are handed off over a bounded channel to a small worker pool
+// that batches MySQL inserts and mirrors each event onto a Redis stream
+// for external consumers.
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// ErrNotSupported is returned by Stats when no MySQL connection backs
+// this Recorder (STORAGE_DRIVER other than mysql): detailed click
+// analytics live only in url_clicks, which is MySQL-only, so there's no
+// data to aggregate rather than a true zero.
+var ErrNotSupported = errors.New("analytics: detailed click stats require STORAGE_DRIVER=mysql")
+
+const (
+	eventBufferSize = 1000            // events queued before Record starts dropping
+	numWorkers      = 4               // goroutines draining the event channel
+	batchSize       = 50              // rows per MySQL insert batch
+	batchInterval   = 2 * time.Second // max time an event waits before being flushed
+	eventsStreamKey = "shortener:events"
+	statsWindowDays = 30
+)
+
+// ClickEvent records a single redirect hit.
+type ClickEvent struct {
+	Domain    string    `json:"domain"`
+	Code      string    `json:"code"`
+	Timestamp time.Time `json:"timestamp"`
+	Referer   string    `json:"referer"`
+	UserAgent string    `json:"userAgent"`
+	ClientIP  string    `json:"clientIp"`
+	Country   string    `json:"country"` // ISO country code; empty if GeoIP isn't configured
+}
+
+// Recorder asynchronously persists ClickEvents: a bounded channel feeds
+// a pool of workers that batch-insert into MySQL and mirror every event
+// onto a Redis stream as it arrives.
+type Recorder struct {
+	db    *sql.DB
+	redis redis.Cmdable
+	geoip *geoip2.Reader
+
+	events chan ClickEvent
+}
+
+// NewRecorder starts the worker pool. db and redisClient may be nil, in
+// which case the corresponding sink is skipped. geoipDBPath may be
+// empty, in which case ClickEvent.Country is left blank.
+func NewRecorder(db *sql.DB, redisClient redis.Cmdable, geoipDBPath string) *Recorder {
+	r := &Recorder{
+		db:     db,
+		redis:  redisClient,
+		events: make(chan ClickEvent, eventBufferSize),
+	}
+	if geoipDBPath != "" {
+		reader, err := geoip2.Open(geoipDBPath)
+		if err != nil {
+			log.Println("analytics: failed to open GeoIP database, country lookup disabled:", err)
+		} else {
+			r.geoip = reader
+		}
+	}
+	for i := 0; i < numWorkers; i++ {
+		go r.worker()
+	}
+	return r
+}
+
+// Record enqueues ev for asynchronous persistence. It never blocks the
+// caller: if the buffer is full, the event is dropped and logged rather
+// than slowing down the redirect it was recorded from.
+func (r *Recorder) Record(ev ClickEvent) {
+	if r.geoip != nil && ev.Country == "" && ev.ClientIP != "" {
+		if ip := net.ParseIP(ev.ClientIP); ip != nil {
+			if rec, err := r.geoip.Country(ip); err == nil {
+				ev.Country = rec.Country.IsoCode
+			}
+		}
+	}
+	select {
+	case r.events <- ev:
+	default:
+		log.Println("analytics: event buffer full, dropping click event for", ev.Domain, ev.Code)
+	}
+}
+
+// worker drains events: it publishes each one to Redis as it arrives
+// and accumulates a batch for MySQL, flushed either when full or after
+// batchInterval so low-traffic codes aren't stuck waiting.
+func (r *Recorder) worker() {
+	batch := make([]ClickEvent, 0, batchSize)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		r.insertBatch(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case ev, ok := <-r.events:
+			if !ok {
+				flush()
+				return
+			}
+			r.publish(ev)
+			batch = append(batch, ev)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (r *Recorder) insertBatch(batch []ClickEvent) {
+	if r.db == nil {
+		return
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Println("analytics: failed to begin click batch transaction:", err)
+		return
+	}
+	stmt, err := tx.Prepare(`INSERT INTO url_clicks(domain, code, clicked_at, referer, user_agent, client_ip, country) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		log.Println("analytics: failed to prepare click insert:", err)
+		tx.Rollback()
+		return
+	}
+	defer stmt.Close()
+	for _, ev := range batch {
+		if _, err := stmt.Exec(ev.Domain, ev.Code, ev.Timestamp, ev.Referer, ev.UserAgent, ev.ClientIP, ev.Country); err != nil {
+			log.Println("analytics: failed to insert click event:", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("analytics: failed to commit click batch:", err)
+	}
+}
+
+func (r *Recorder) publish(ev ClickEvent) {
+	if r.redis == nil {
+		return
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		log.Println("analytics: failed to marshal click event:", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := r.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventsStreamKey,
+		Values: map[string]interface{}{"event": payload},
+	}).Err(); err != nil {
+		log.Println("analytics: failed to publish click event to Redis stream:", err)
+	}
+}
+
+// CountEntry is one row of a top-N breakdown (referer or user agent).
+type CountEntry struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Stats is the JSON summary returned by GET /stats/{code}.
+type Stats struct {
+	Domain        string           `json:"domain"`
+	Code          string           `json:"code"`
+	TotalClicks   int64            `json:"totalClicks"`
+	ClicksPerDay  map[string]int64 `json:"clicksPerDay"`
+	TopReferers   []CountEntry     `json:"topReferers"`
+	TopUserAgents []CountEntry     `json:"topUserAgents"`
+}
+
+// Stats aggregates url_clicks for (domain, code): total clicks,
+// clicks-per-day for the last statsWindowDays days, and the top 5
+// referers and user agents.
+func (r *Recorder) Stats(ctx context.Context, domain, code string) (*Stats, error) {
+	if r.db == nil {
+		return nil, ErrNotSupported
+	}
+	stats := &Stats{Domain: domain, Code: code, ClicksPerDay: make(map[string]int64)}
+
+	if err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM url_clicks WHERE domain = ? AND code = ?`,
+		domain, code,
+	).Scan(&stats.TotalClicks); err != nil {
+		return nil, err
+	}
+
+	since := time.Now().AddDate(0, 0, -statsWindowDays)
+	dayRows, err := r.db.QueryContext(ctx,
+		`SELECT DATE(clicked_at) AS day, COUNT(*) FROM url_clicks
+		 WHERE domain = ? AND code = ? AND clicked_at >= ?
+		 GROUP BY day`,
+		domain, code, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer dayRows.Close()
+	for dayRows.Next() {
+		var day string
+		var count int64
+		if err := dayRows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		stats.ClicksPerDay[day] = count
+	}
+	if err := dayRows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats.TopReferers, err = r.topColumn(ctx, domain, code, "referer")
+	if err != nil {
+		return nil, err
+	}
+	stats.TopUserAgents, err = r.topColumn(ctx, domain, code, "user_agent")
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// topColumn returns the 5 most frequent non-empty values of column
+// (either "referer" or "user_agent") for (domain, code).
+func (r *Recorder) topColumn(ctx context.Context, domain, code, column string) ([]CountEntry, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+column+`, COUNT(*) AS c FROM url_clicks
+		 WHERE domain = ? AND code = ? AND `+column+` <> ''
+		 GROUP BY `+column+` ORDER BY c DESC LIMIT 5`,
+		domain, code,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []CountEntry
+	for rows.Next() {
+		var e CountEntry
+		if err := rows.Scan(&e.Value, &e.Count); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,105 @@
+// Package auth gates the URL management API behind per-caller API
+// keys and rate-limits the public creation endpoint.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// APIKey identifies the caller that authenticated a management-API
+// request.
+type APIKey struct {
+	ID    int64
+	Label string
+}
+
+// RequireAPIKey wraps next so it only runs for requests bearing an
+// "Authorization: Bearer <token>" header matching an active, non-
+// revoked row in the api_keys table. Tokens are never stored in
+// plaintext; lookups hash the presented token and compare against
+// key_hash. db is nil whenever STORAGE_DRIVER isn't mysql (the
+// api_keys table only ever lives in MySQL), in which case every
+// request is rejected with 503 rather than panicking on a nil *sql.DB.
+func RequireAPIKey(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			http.Error(w, "Service Unavailable: API key store not configured", http.StatusServiceUnavailable)
+			return
+		}
+		token := BearerToken(r)
+		if token == "" {
+			http.Error(w, "Unauthorized: missing API key", http.StatusUnauthorized)
+			return
+		}
+		if _, err := lookupAPIKey(r.Context(), db, token); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Unauthorized: invalid API key", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		next(w, r)
+	}
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>"
+// header, or "" if the header is absent or malformed.
+func BearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, prefix) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(h, prefix))
+}
+
+// HashToken returns the stable lookup key stored in api_keys.key_hash
+// for a caller-presented token. Plain SHA-256 (rather than bcrypt) is
+// used because API keys are high-entropy random tokens, not
+// human-chosen passwords, so a fast, indexable hash is appropriate.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func lookupAPIKey(ctx context.Context, db *sql.DB, token string) (*APIKey, error) {
+	var key APIKey
+	err := db.QueryRowContext(ctx,
+		`SELECT id, label FROM api_keys WHERE key_hash = ? AND revoked = FALSE`,
+		HashToken(token),
+	).Scan(&key.ID, &key.Label)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// HashPassword hashes a link password for storage. It returns "" for an
+// empty password, meaning "no password set".
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash. An empty hash
+// means the link has no password, so every input matches.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
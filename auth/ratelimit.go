@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RateLimiter is a fixed-window counter per key, implemented with Redis
+// INCR + EXPIRE (e.g. key "rl:{key}:{minute}"), so limits are shared
+// across every instance of the service rather than per-process.
+type RateLimiter struct {
+	redis  redis.Cmdable
+	limit  int64
+	window time.Duration
+}
+
+// NewRateLimiter returns a RateLimiter allowing up to limit calls per
+// window for a given key. redisClient may be nil, in which case Allow
+// always permits the call (fail-open), matching how the rest of the
+// service treats Redis as an optional accelerator rather than a hard
+// dependency.
+func NewRateLimiter(redisClient redis.Cmdable, limit int64, window time.Duration) *RateLimiter {
+	return &RateLimiter{redis: redisClient, limit: limit, window: window}
+}
+
+// Allow reports whether another call identified by key is within the
+// limit for the current window.
+func (rl *RateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	if rl.redis == nil {
+		return true, nil
+	}
+	windowSecs := int64(rl.window / time.Second)
+	bucket := fmt.Sprintf("rl:%s:%d", key, time.Now().Unix()/windowSecs)
+
+	count, err := rl.redis.Incr(ctx, bucket).Result()
+	if err != nil {
+		return false, err
+	}
+	if count == 1 {
+		// First hit in this window starts its expiry; ignore errors,
+		// since a missed EXPIRE only leaves a stale bucket key behind
+		// (the next window counts under a new key), not under-counting.
+		rl.redis.Expire(ctx, bucket, rl.window)
+	}
+	return count <= rl.limit, nil
+}
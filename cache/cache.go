@@ -0,0 +1,196 @@
+// Package cache provides a storage-agnostic caching layer for short URL
+// lookups. It abstracts over single-node Redis, Redis Sentinel (HA
+// failover), and Redis Cluster so the rest of the application does not
+// need to know which topology is in use. A process-local in-memory
+// implementation is also provided for tests and for environments with
+// no Redis configured.
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Cache is the minimal interface the application needs from a cache
+// backend. All implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored at key, or ErrNotFound (redis.Nil,
+	// unwrapped) if the key does not exist.
+	Get(ctx context.Context, key string) (string, error)
+	// Set stores value at key. A ttl of 0 means "no expiration".
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// Del removes key from the cache. Deleting a missing key is not an
+	// error.
+	Del(ctx context.Context, key string) error
+	// Ping verifies connectivity to the backend.
+	Ping(ctx context.Context) error
+}
+
+// ErrNotFound is returned by Get when the key is absent. It is aliased
+// to redis.Nil for the Redis-backed implementations so callers can keep
+// comparing against a single sentinel value regardless of backend.
+var ErrNotFound = redis.Nil
+
+// Mode identifies which Redis topology to connect to.
+type Mode string
+
+const (
+	ModeSingle   Mode = "single"
+	ModeSentinel Mode = "sentinel"
+	ModeCluster  Mode = "cluster"
+)
+
+// redisCache adapts a go-redis client (single-node or sentinel failover,
+// both of which are *redis.Client) to the Cache interface.
+type redisCache struct {
+	client *redis.Client
+}
+
+// NewSingle builds a Cache backed by a single Redis node.
+func NewSingle(addr, password string, db int) *redisCache {
+	return &redisCache{client: redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})}
+}
+
+// NewSentinel builds a Cache backed by a Redis Sentinel-monitored
+// master, failing over automatically when Sentinel promotes a replica.
+func NewSentinel(masterName string, sentinelAddrs []string, password string, db int) *redisCache {
+	return &redisCache{client: redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:    masterName,
+		SentinelAddrs: sentinelAddrs,
+		Password:      password,
+		DB:            db,
+	})}
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) (string, error) {
+	return c.client.Get(ctx, key).Result()
+}
+
+func (c *redisCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *redisCache) Del(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+// Ping checks connectivity to the Redis node(s).
+func (c *redisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Raw exposes the underlying go-redis client for callers that need
+// commands beyond Get/Set/Del (e.g. the codec package's Redis-backed ID
+// sequence, which uses INCRBY).
+func (c *redisCache) Raw() redis.Cmdable {
+	return c.client
+}
+
+// clusterCache adapts a *redis.ClusterClient to the Cache interface.
+type clusterCache struct {
+	client *redis.ClusterClient
+}
+
+// NewCluster builds a Cache backed by a Redis Cluster, given the
+// addresses of one or more seed nodes.
+func NewCluster(addrs []string, password string) *clusterCache {
+	return &clusterCache{client: redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:    addrs,
+		Password: password,
+	})}
+}
+
+func (c *clusterCache) Get(ctx context.Context, key string) (string, error) {
+	return c.client.Get(ctx, key).Result()
+}
+
+func (c *clusterCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *clusterCache) Del(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+func (c *clusterCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Raw exposes the underlying go-redis cluster client; see
+// redisCache.Raw.
+func (c *clusterCache) Raw() redis.Cmdable {
+	return c.client
+}
+
+// Memory is an in-process Cache implementation with no persistence,
+// used as a fallback when no Redis is configured and in unit tests.
+type Memory struct {
+	mu   sync.RWMutex
+	data map[string]string
+}
+
+// NewMemory returns an empty in-memory Cache.
+func NewMemory() *Memory {
+	return &Memory{data: make(map[string]string)}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	val, ok := m.data[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return val, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	if ttl > 0 {
+		go func() {
+			time.Sleep(ttl)
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if v, ok := m.data[key]; ok && v == value {
+				delete(m.data, key)
+			}
+		}()
+	}
+	return nil
+}
+
+func (m *Memory) Del(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+// Ping always succeeds; the in-memory backend has no external
+// connection to verify.
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// ParseAddrs splits a comma-separated list of host:port addresses, e.g.
+// the value of REDIS_SENTINEL_ADDRS or REDIS_CLUSTER_ADDRS.
+func ParseAddrs(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
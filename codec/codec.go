@@ -0,0 +1,60 @@
+// Package codec turns monotonically increasing integer IDs into short,
+// fixed-width base62 codes. Because the IDs are allocated from a single
+// counter (MySQL AUTO_INCREMENT or a Redis-backed range allocator), two
+// callers never produce the same code, which removes the need for the
+// insert-and-retry-on-collision pattern used by random code generation.
+package codec
+
+import "fmt"
+
+// charset is ordered 0-9, a-z, A-Z. Order only matters for Decode, which
+// nothing outside this package's tests calls, but is kept for completeness.
+const charset = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+const base = uint64(len(charset))
+
+// codeLength matches shortCodePattern in main.go; codes are always
+// padded or truncated to this width.
+const codeLength = 9
+
+// Encode base62-encodes id and pads (with leading zero digits) or
+// truncates it to exactly codeLength characters. The digit-extraction
+// loop below naturally reduces id mod 62^codeLength (each iteration
+// peels off one base-62 digit and discards the rest), so IDs beyond
+// 62^codeLength-1 wrap around and share a code with id mod
+// 62^codeLength. IDs are scrambled with
+// Scramble before being passed here, so that wraparound does not
+// introduce visible sequential patterns.
+func Encode(id uint64) string {
+	buf := make([]byte, codeLength)
+	for i := codeLength - 1; i >= 0; i-- {
+		buf[i] = charset[id%base]
+		id /= base
+	}
+	return string(buf)
+}
+
+// Decode reverses Encode. It does not reverse Scramble.
+func Decode(code string) (uint64, error) {
+	if len(code) != codeLength {
+		return 0, fmt.Errorf("codec: code must be %d characters, got %d", codeLength, len(code))
+	}
+	var id uint64
+	for i := 0; i < len(code); i++ {
+		idx := indexOf(code[i])
+		if idx < 0 {
+			return 0, fmt.Errorf("codec: invalid character %q in code %q", code[i], code)
+		}
+		id = id*base + uint64(idx)
+	}
+	return id, nil
+}
+
+func indexOf(c byte) int {
+	for i := 0; i < len(charset); i++ {
+		if charset[i] == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,47 @@
+package codec
+
+import "testing"
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	ids := []uint64{0, 1, 9, 61, 62, 1000, 123456789, 35424, 26707}
+	for _, id := range ids {
+		code := Encode(id)
+		if len(code) != codeLength {
+			t.Errorf("Encode(%d) = %q, want length %d", id, code, codeLength)
+		}
+		got, err := Decode(code)
+		if err != nil {
+			t.Fatalf("Decode(%q) returned error: %v", code, err)
+		}
+		if got != id {
+			t.Errorf("Decode(Encode(%d)) = %d, want %d", id, got, id)
+		}
+	}
+}
+
+// TestEncodeNoCollisions guards against the bug where a bitmask in
+// Encode collapsed the effective code space and produced a collision as
+// early as id=35424; sequential IDs (after Scramble, as main.go always
+// calls it) must never produce the same code.
+func TestEncodeNoCollisions(t *testing.T) {
+	seen := make(map[string]uint64, 200000)
+	for id := uint64(0); id < 200000; id++ {
+		code := Encode(Scramble(id))
+		if prev, ok := seen[code]; ok {
+			t.Fatalf("collision: id=%d and id=%d both encode to %q", id, prev, code)
+		}
+		seen[code] = id
+	}
+}
+
+func TestDecodeInvalidLength(t *testing.T) {
+	if _, err := Decode("short"); err == nil {
+		t.Error("Decode with wrong length: want error, got nil")
+	}
+}
+
+func TestDecodeInvalidCharacter(t *testing.T) {
+	if _, err := Decode("abcdefg-h"); err == nil {
+		t.Error("Decode with invalid character: want error, got nil")
+	}
+}
@@ -0,0 +1,53 @@
+package codec
+
+// Scramble permutes the 54 low bits of a sequential ID with a
+// fixed-round Feistel network so that consecutive IDs (1, 2, 3, ...)
+// produce codes that look unrelated, while the mapping stays a
+// deterministic bijection (no collisions, no shared state). The high bits
+// of a uint64 are left untouched. 54 bits is one more than codeLength
+// base62 digits can hold (2^53 < 62^9 < 2^54), so a scrambled value can
+// reach 62^codeLength or beyond; Encode reduces such a value mod
+// 62^codeLength, and nextCode in main.go scrambles it again until it fits.
+const scrambleBits = 54
+const halfBits = scrambleBits / 2 // 27
+const halfMask = uint64(1)<<halfBits - 1
+
+// feistelKeys (one per round) are arbitrary fixed constants; they only
+// need to be stable across restarts, not secret or cryptographically
+// strong, since the goal is visual de-sequencing, not security.
+var feistelKeys = [4]uint64{0x9E3779B97F4A7C15, 0xC2B2AE3D27D4EB4F, 0x165667B19E3779F9, 0x27D4EB2F165667C5}
+
+func feistelRound(half, key uint64) uint64 {
+	// Simple mixing function on the 27-bit half-block.
+	h := (half ^ key) * 0x2545F4914F6CDD1D
+	return (h ^ (h >> 13)) & halfMask
+}
+
+// Scramble returns id with its low scrambleBits bits permuted. Bits
+// above scrambleBits are passed through unchanged.
+func Scramble(id uint64) uint64 {
+	low := id & (uint64(1)<<scrambleBits - 1)
+	high := id &^ (uint64(1)<<scrambleBits - 1)
+
+	l := low & halfMask
+	r := (low >> halfBits) & halfMask
+	for _, key := range feistelKeys {
+		l, r = r, l^feistelRound(r, key)
+	}
+	scrambled := (l << halfBits) | r
+	return high | scrambled
+}
+
+// Unscramble reverses Scramble.
+func Unscramble(id uint64) uint64 {
+	low := id & (uint64(1)<<scrambleBits - 1)
+	high := id &^ (uint64(1)<<scrambleBits - 1)
+
+	l := (low >> halfBits) & halfMask
+	r := low & halfMask
+	for i := len(feistelKeys) - 1; i >= 0; i-- {
+		l, r = r^feistelRound(l, feistelKeys[i]), l
+	}
+	unscrambled := (r << halfBits) | l
+	return high | unscrambled
+}
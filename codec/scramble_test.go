@@ -0,0 +1,38 @@
+package codec
+
+import "testing"
+
+func TestScrambleUnscrambleRoundTrip(t *testing.T) {
+	ids := []uint64{0, 1, 2, 61, 1000, 123456789, 1 << 53, (1 << 54) - 1}
+	for _, id := range ids {
+		scrambled := Scramble(id)
+		got := Unscramble(scrambled)
+		if got != id {
+			t.Errorf("Unscramble(Scramble(%d)) = %d, want %d", id, got, id)
+		}
+	}
+}
+
+// TestScrambleHighBitsUntouched checks that bits above scrambleBits pass
+// through Scramble unchanged, as documented.
+func TestScrambleHighBitsUntouched(t *testing.T) {
+	id := uint64(1)<<scrambleBits | 42
+	scrambled := Scramble(id)
+	if scrambled&^(uint64(1)<<scrambleBits-1) == 0 {
+		t.Errorf("Scramble(%d) = %d, expected high bit above scrambleBits to survive", id, scrambled)
+	}
+}
+
+// TestScrambleIsBijective samples a range of sequential low-order IDs and
+// checks Scramble never maps two of them to the same value, i.e. it
+// behaves as the permutation Scramble's doc promises.
+func TestScrambleIsBijective(t *testing.T) {
+	seen := make(map[uint64]uint64, 100000)
+	for id := uint64(0); id < 100000; id++ {
+		s := Scramble(id)
+		if prev, ok := seen[s]; ok {
+			t.Fatalf("collision: id=%d and id=%d both scramble to %d", id, prev, s)
+		}
+		seen[s] = id
+	}
+}
@@ -2,13 +2,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"regexp"
@@ -16,38 +18,109 @@ import (
 	"sync"
 	"time"
 
-	"github.com/go-redis/redis/v8"   // Redis client
-	"github.com/go-sql-driver/mysql" // MySQL driver
+	"github.com/go-redis/redis/v8"
+	_ "github.com/go-sql-driver/mysql" // MySQL driver
+	_ "github.com/lib/pq"              // PostgreSQL driver
+
+	"github.com/tiffanyXiaoqing/URL-Shortener-Service/analytics"
+	"github.com/tiffanyXiaoqing/URL-Shortener-Service/auth"
+	"github.com/tiffanyXiaoqing/URL-Shortener-Service/cache"
+	"github.com/tiffanyXiaoqing/URL-Shortener-Service/codec"
+	"github.com/tiffanyXiaoqing/URL-Shortener-Service/storage"
+)
+
+// redirectPermanent and redirectTemporary are the allowed values of
+// newURLRequest.RedirectType / storage.Record.RedirectType, controlling
+// whether handleRedirect issues a 301 or a 302. Temporary is the
+// default: browsers and CDNs cache a 301 aggressively, which would make
+// retargeting a link impossible.
+const (
+	redirectPermanent = "permanent"
+	redirectTemporary = "temporary"
 )
 
-// Global variables for database and cache connections, and a flag for memory mode
+// maxCodeInsertAttempts bounds the retries saveURLMapping makes when a
+// freshly generated code collides with a row a caller-supplied alias put
+// there first; a handful of attempts is enough since each retry draws a
+// brand new code from the sequence.
+const maxCodeInsertAttempts = 5
+
+// Global variables for database and cache connections.
 var (
-	db          *sql.DB       // MySQL database connection
-	redisClient *redis.Client // Redis cache client
-	useMemory   bool          // if true, use in-memory storage instead of DB
+	db         *sql.DB     // MySQL connection; only non-nil when STORAGE_DRIVER=mysql succeeds
+	redisCache cache.Cache // Cache backend (single/sentinel/cluster/memory)
+	store      storage.Store
 )
 
-// In-memory store (used only if DB is not available, e.g., for testing)
-type memoryStore struct {
-	sync.RWMutex
-	data map[string]string // maps "domain:code" -> original URL
-}
+// Global variables for monotonic short code generation. At most one of
+// mysqlSeqSource / redisSeqClient is set, in that order of preference;
+// if neither is available codeSourceFor falls back to an in-process
+// counter per domain (domainSeqSrc).
+var (
+	mysqlSeqSource *codec.MySQLSource
+	redisSeqClient redis.Cmdable
+	redisSeqBatch  uint64
+
+	domainSeqMu  sync.Mutex
+	domainSeqSrc = make(map[string]codec.Source)
+)
+
+// clickRecorder records redirect hits and serves aggregate stats. Set
+// up in main(); nil only before initialization is reached.
+var clickRecorder *analytics.Recorder
+
+// rateLimiter throttles /newurl per caller (API key if presented,
+// otherwise client IP). Always non-nil; it fails open when Redis isn't
+// configured, see auth.RateLimiter.
+var rateLimiter *auth.RateLimiter
+
+// cdnPurgeURL, if set (from CDN_PURGE_URL), receives a POST from
+// purgeCDN whenever PATCH /api/urls/{code} retargets a link, so a CDN
+// sitting in front of the service can drop its cached 301/302.
+var cdnPurgeURL string
 
-var memStore = memoryStore{data: make(map[string]string)}
+// purgeClient is used for the best-effort CDN purge webhook call; a
+// short timeout keeps a slow/unreachable CDN from blocking the PATCH
+// request that triggered it.
+var purgeClient = &http.Client{Timeout: 5 * time.Second}
+
+// errAliasTaken is returned by saveURLMapping when a caller-supplied
+// alias is already in use.
+var errAliasTaken = errors.New("alias already in use")
 
 // Regex to validate short code format in the URL path.
 var shortCodePattern = regexp.MustCompile(`^/[A-Za-z0-9]{9}$`)
 
 // Structures for JSON input and output
 type newURLRequest struct {
-	Domain string `json:"domain"`
-	URL    string `json:"url"`
+	Domain       string `json:"domain"`
+	URL          string `json:"url"`
+	Alias        string `json:"alias,omitempty"`        // optional custom short code, must match shortCodePattern
+	ExpiresAt    string `json:"expiresAt,omitempty"`    // optional RFC3339 timestamp; empty means no expiration
+	Password     string `json:"password,omitempty"`     // optional password required to follow the redirect
+	RedirectType string `json:"redirectType,omitempty"` // "permanent" or "temporary"; defaults to temporary
 }
 type newURLResponse struct {
 	URL        string `json:"url"`
 	ShortenURL string `json:"shortenUrl"`
 }
 
+// updateURLRequest is the PATCH /api/urls/{code} body used to retarget
+// an existing link.
+type updateURLRequest struct {
+	URL          string `json:"url"`
+	RedirectType string `json:"redirectType,omitempty"`
+}
+
+// urlOptions carries the optional newURLRequest fields through to
+// saveURLMapping.
+type urlOptions struct {
+	Alias        string
+	ExpiresAt    *time.Time
+	PasswordHash string
+	RedirectType string
+}
+
 func main() {
 	// Read configuration from environment (for real deployments)
 	mysqlDSN := os.Getenv("MYSQL_DSN")   // e.g., "user:pass@tcp(host:3306)/dbname"
@@ -59,45 +132,147 @@ func main() {
 		fmt.Sscanf(dbStr, "%d", &redisDBIdx)
 	}
 
-	// Initialize MySQL connection
-	if mysqlDSN != "" {
-		var err error
-		db, err = sql.Open("mysql", mysqlDSN)
+	// Initialize the URL-mapping storage backend. STORAGE_DRIVER selects
+	// mysql (the default, using MYSQL_DSN for backward compatibility),
+	// postgres, or memory; mysql and postgres both also accept the
+	// driver-agnostic DATABASE_URL in place of MYSQL_DSN.
+	databaseURL := os.Getenv("DATABASE_URL")
+	storageDriver := os.Getenv("STORAGE_DRIVER")
+	if storageDriver == "" {
+		storageDriver = "mysql"
+	}
+	switch storageDriver {
+	case "postgres":
+		dsn := databaseURL
+		if dsn == "" {
+			log.Println("STORAGE_DRIVER=postgres requires DATABASE_URL, proceeding without it.")
+			break
+		}
+		pgDB, err := sql.Open("postgres", dsn)
 		if err != nil {
-			log.Println("Failed to open MySQL connection:", err)
-		} else if err = db.Ping(); err != nil {
-			log.Println("MySQL ping failed, using in-memory store. Error:", err)
-			db = nil
+			log.Println("Failed to open PostgreSQL connection:", err)
+		} else if err := pgDB.Ping(); err != nil {
+			log.Println("PostgreSQL ping failed. Error:", err)
+		} else if pgStore, err := storage.NewPostgresStore(pgDB); err != nil {
+			log.Println("Failed to initialize PostgreSQL storage:", err)
 		} else {
-			// Ensure the necessary table exists
-			createTable()
+			store = pgStore
+			log.Println("Using PostgreSQL storage.")
+		}
+	case "memory":
+		// store is set to storage.NewMemoryStore() below.
+	default:
+		dsn := mysqlDSN
+		if dsn == "" {
+			dsn = databaseURL
+		}
+		if dsn != "" {
+			var err error
+			db, err = sql.Open("mysql", dsn)
+			if err != nil {
+				log.Println("Failed to open MySQL connection:", err)
+			} else if err = db.Ping(); err != nil {
+				log.Println("MySQL ping failed. Error:", err)
+				db = nil
+			} else if mysqlStore, err := storage.NewMySQLStore(db); err != nil {
+				log.Println("Failed to initialize MySQL storage:", err)
+				db = nil
+			} else {
+				store = mysqlStore
+				log.Println("Using MySQL storage.")
+			}
 		}
 	}
-	if db == nil {
-		useMemory = true
+	if store == nil {
+		store = storage.NewMemoryStore()
 		log.Println("Using in-memory storage (no persistence).")
 	}
 
-	// Initialize Redis connection (if configured)
-	if redisAddr != "" {
-		redisClient = redis.NewClient(&redis.Options{
-			Addr:     redisAddr,
-			Password: redisPass,
-			DB:       redisDBIdx,
-		})
+	// Initialize the cache backend according to REDIS_MODE. Single-node is
+	// the default so existing REDIS_ADDR-only deployments keep working.
+	redisMode := cache.Mode(os.Getenv("REDIS_MODE"))
+	if redisMode == "" {
+		redisMode = cache.ModeSingle
+	}
+	switch redisMode {
+	case cache.ModeSentinel:
+		sentinelAddrs := cache.ParseAddrs(os.Getenv("REDIS_SENTINEL_ADDRS"))
+		masterName := os.Getenv("REDIS_MASTER_NAME")
+		if len(sentinelAddrs) == 0 || masterName == "" {
+			log.Println("REDIS_MODE=sentinel requires REDIS_SENTINEL_ADDRS and REDIS_MASTER_NAME, proceeding without cache.")
+			break
+		}
+		redisCache = cache.NewSentinel(masterName, sentinelAddrs, redisPass, redisDBIdx)
+	case cache.ModeCluster:
+		clusterAddrs := cache.ParseAddrs(os.Getenv("REDIS_CLUSTER_ADDRS"))
+		if len(clusterAddrs) == 0 {
+			log.Println("REDIS_MODE=cluster requires REDIS_CLUSTER_ADDRS, proceeding without cache.")
+			break
+		}
+		redisCache = cache.NewCluster(clusterAddrs, redisPass)
+	default:
+		if redisAddr != "" {
+			redisCache = cache.NewSingle(redisAddr, redisPass, redisDBIdx)
+		}
+	}
+	if redisCache != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 		defer cancel()
-		if err := redisClient.Ping(ctx).Err(); err != nil {
+		if err := redisCache.Ping(ctx); err != nil {
 			log.Println("Redis connection failed, proceeding without cache. Error:", err)
-			redisClient = nil
+			redisCache = nil
 		} else {
-			log.Println("Connected to Redis cache.")
+			log.Println("Connected to Redis cache in", redisMode, "mode.")
 		}
 	}
 
+	// Extract the raw go-redis client/cluster-client underlying
+	// redisCache, if any, for commands (INCRBY, XADD) that fall outside
+	// the Get/Set/Del cache abstraction.
+	var redisRaw redis.Cmdable
+	if raw, ok := redisCache.(interface{ Raw() redis.Cmdable }); ok {
+		redisRaw = raw.Raw()
+	}
+
+	// Set up the ID source used to generate monotonic short codes.
+	// MySQL's AUTO_INCREMENT is preferred when a database is configured
+	// (it's durable and already the source of truth); otherwise a Redis
+	// INCRBY range allocator is used if a Redis-backed cache is
+	// connected; otherwise codes fall back to a per-domain in-process
+	// counter, matching the existing in-memory storage fallback.
+	if db != nil {
+		createSeqTable()
+		mysqlSeqSource = codec.NewMySQLSource(db, "shortener_seq")
+	} else if redisRaw != nil {
+		redisSeqClient = redisRaw
+		redisSeqBatch = 1000
+		if v := os.Getenv("REDIS_SEQ_BATCH_SIZE"); v != "" {
+			fmt.Sscanf(v, "%d", &redisSeqBatch)
+		}
+	}
+
+	// Set up click analytics: a worker pool batches click events into
+	// MySQL and mirrors each one onto a Redis stream for subscribers.
+	createClicksTable()
+	clickRecorder = analytics.NewRecorder(db, redisRaw, os.Getenv("GEOIP_DB_PATH"))
+
+	// Set up the api_keys table and the /newurl rate limiter. The limit
+	// applies per API key when the caller presents one, otherwise per
+	// client IP.
+	createAPIKeysTable()
+	rateLimit := int64(60)
+	if v := os.Getenv("RATE_LIMIT_PER_MINUTE"); v != "" {
+		fmt.Sscanf(v, "%d", &rateLimit)
+	}
+	rateLimiter = auth.NewRateLimiter(redisRaw, rateLimit, time.Minute)
+
+	cdnPurgeURL = os.Getenv("CDN_PURGE_URL")
+
 	// Set up HTTP handlers
-	http.HandleFunc("/newurl", handleNewURL) // for creating new short URLs
-	http.HandleFunc("/", handleRedirect)     // for redirecting short URLs (catch-all)
+	http.HandleFunc("/newurl", handleNewURL)                              // for creating new short URLs
+	http.HandleFunc("/stats/", handleStats)                               // for GET /stats/{code} click analytics
+	http.HandleFunc("/api/urls/", auth.RequireAPIKey(db, handleURLManage)) // for GET/PATCH/DELETE /api/urls/{code}
+	http.HandleFunc("/", handleRedirect)                                  // for redirecting short URLs (catch-all)
 
 	// Start the HTTP server
 	port := os.Getenv("PORT")
@@ -108,22 +283,65 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
-// createTable creates the database table for URL storage if it doesn't already exist.
-func createTable() {
+// createSeqTable creates the AUTO_INCREMENT counter table backing
+// mysqlSeqSource, if it doesn't already exist.
+func createSeqTable() {
 	if db == nil {
 		return
 	}
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS shortened_urls (
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS shortener_seq (
+        id BIGINT AUTO_INCREMENT PRIMARY KEY
+    ) ENGINE=InnoDB;`)
+	if err != nil {
+		log.Println("Error creating sequence table:", err)
+	} else {
+		log.Println("Verified that 'shortener_seq' table exists or was created.")
+	}
+}
+
+// createAPIKeysTable creates the table backing the API-key middleware,
+// if it doesn't already exist. Rows are provisioned out-of-band (e.g. a
+// migration or admin tool); this service only ever reads key_hash.
+func createAPIKeysTable() {
+	if db == nil {
+		return
+	}
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS api_keys (
+        id BIGINT AUTO_INCREMENT PRIMARY KEY,
+        key_hash VARCHAR(64) NOT NULL,
+        label VARCHAR(255) NOT NULL DEFAULT '',
+        revoked BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE KEY unique_key_hash (key_hash)
+    ) ENGINE=InnoDB;`)
+	if err != nil {
+		log.Println("Error creating api_keys table:", err)
+	} else {
+		log.Println("Verified that 'api_keys' table exists or was created.")
+	}
+}
+
+// createClicksTable creates the table backing click analytics, if it
+// doesn't already exist.
+func createClicksTable() {
+	if db == nil {
+		return
+	}
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS url_clicks (
         id BIGINT AUTO_INCREMENT PRIMARY KEY,
         domain VARCHAR(255) NOT NULL,
         code VARCHAR(9) NOT NULL,
-        original_url TEXT NOT NULL,
-        UNIQUE KEY unique_domain_code (domain, code)
+        clicked_at DATETIME NOT NULL,
+        referer TEXT NOT NULL,
+        user_agent TEXT NOT NULL,
+        client_ip VARCHAR(45) NOT NULL,
+        country VARCHAR(2) NOT NULL,
+        INDEX idx_domain_code (domain, code)
     ) ENGINE=InnoDB;`)
 	if err != nil {
-		log.Println("Error creating table:", err)
+		log.Println("Error creating clicks table:", err)
 	} else {
-		log.Println("Verified that 'shortened_urls' table exists or was created.")
+		log.Println("Verified that 'url_clicks' table exists or was created.")
 	}
 }
 
@@ -133,6 +351,15 @@ func handleNewURL(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
+
+	allowed, err := rateLimiter.Allow(r.Context(), rateLimitKey(r))
+	if err != nil {
+		log.Println("Warning: rate limiter error:", err)
+	} else if !allowed {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
 	var req newURLRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
@@ -145,21 +372,53 @@ func handleNewURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Save the URL mapping (generate short code and store in DB or memory)
-	code, err := saveURLMapping(req.Domain, req.URL)
+	opts := urlOptions{}
+	if req.Alias != "" {
+		if !shortCodePattern.MatchString("/" + req.Alias) {
+			http.Error(w, "Bad Request: 'alias' must be 9 alphanumeric characters", http.StatusBadRequest)
+			return
+		}
+		opts.Alias = req.Alias
+	}
+	if req.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			http.Error(w, "Bad Request: 'expiresAt' must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.ExpiresAt = &expiresAt
+	}
+	if req.Password != "" {
+		passwordHash, err := auth.HashPassword(req.Password)
+		if err != nil {
+			log.Println("Error hashing link password:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		opts.PasswordHash = passwordHash
+	}
+	switch req.RedirectType {
+	case "", redirectTemporary:
+		opts.RedirectType = redirectTemporary
+	case redirectPermanent:
+		opts.RedirectType = redirectPermanent
+	default:
+		http.Error(w, "Bad Request: 'redirectType' must be 'permanent' or 'temporary'", http.StatusBadRequest)
+		return
+	}
+
+	// Save the URL mapping (generate or reserve the short code and store in DB or memory)
+	code, err := saveURLMapping(req.Domain, req.URL, opts)
 	if err != nil {
+		if errors.Is(err, errAliasTaken) {
+			http.Error(w, "Conflict: alias already in use", http.StatusConflict)
+			return
+		}
 		log.Println("Error saving URL mapping:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-
-	// Build the full shortened URL to return
-	scheme := "https://"
-	// Use http scheme for localhost or IP addresses (assuming no SSL in dev)
-	if strings.Contains(req.Domain, "localhost") || strings.Contains(req.Domain, "127.0.0.1") {
-		scheme = "http://"
-	}
-	shortURL := fmt.Sprintf("%s%s/%s", scheme, req.Domain, code)
+	shortURL := shortURLFor(req.Domain, code)
 
 	// Respond with JSON
 	resp := newURLResponse{
@@ -184,16 +443,12 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	code := path[1:] // strip leading "/"
-	// Determine the domain for lookup from the Host header
-	domain := strings.ToLower(r.Host)
-	if idx := strings.Index(domain, ":"); idx != -1 {
-		domain = domain[:idx] // remove port if present (e.g., "localhost:8080" -> "localhost")
-	}
+	domain := domainFromHost(r.Host)
 
 	// Lookup the original URL from storage (cache or DB)
-	origURL, err := getOriginalURL(domain, code)
+	rec, err := getOriginalURL(domain, code)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, storage.ErrNotFound) {
 			// No mapping found for this code
 			http.NotFound(w, r)
 		} else {
@@ -203,132 +458,459 @@ func handleRedirect(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if rec.ExpiresAt != nil && !rec.ExpiresAt.After(time.Now()) {
+		http.Error(w, "Gone: this link has expired", http.StatusGone)
+		return
+	}
+	if rec.PasswordHash != "" && !auth.CheckPassword(rec.PasswordHash, r.URL.Query().Get("password")) {
+		http.Error(w, "Unauthorized: this link requires a password", http.StatusUnauthorized)
+		return
+	}
+
+	// Let intermediate caches revalidate cheaply instead of re-fetching:
+	// an unchanged link (same destination, same UpdatedAt) can be
+	// answered with a 304 without bumping the click counter or recording
+	// a click.
+	etag := redirectETag(rec)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", rec.UpdatedAt.UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Bump the lightweight running total kept on the mapping itself; this
+	// is independent of (and coarser than) the detailed per-click event
+	// log below, so a failure here is logged but never blocks the redirect.
+	go func() {
+		if err := store.IncrementClicks(context.Background(), domain, code); err != nil {
+			log.Println("Warning: failed to increment click count for", domain, code, ":", err)
+		}
+	}()
+
+	// Record the click asynchronously; this never blocks the redirect.
+	clickRecorder.Record(analytics.ClickEvent{
+		Domain:    domain,
+		Code:      code,
+		Timestamp: time.Now(),
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+		ClientIP:  clientIP(r),
+	})
+
+	// A permanent link's destination is expected to stay put, so let
+	// intermediate caches hold onto it but revalidate via ETag; a
+	// temporary link can be retargeted at any time, so disallow storing
+	// it at all.
+	redirectStatus := http.StatusFound
+	if rec.RedirectType == redirectPermanent {
+		redirectStatus = http.StatusMovedPermanently
+		w.Header().Set("Cache-Control", "public, max-age=0, must-revalidate")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
 
-	// Issue a 301 redirect to the original URL
-	http.Redirect(w, r, origURL, http.StatusMovedPermanently)
+	http.Redirect(w, r, rec.OriginalURL, redirectStatus)
 }
 
-// saveURLMapping generates a unique short code for the given URL and stores the mapping in the database (or memory).
-// Returns the short code.
-func saveURLMapping(domain, originalURL string) (string, error) {
-	if useMemory {
-		// Store in in-memory map (non-persistent, for testing/fallback)
-		for attempt := 0; attempt < 5; attempt++ {
-			code := generateCode(9)
-			key := domain + ":" + code
-			memStore.Lock()
-			if _, exists := memStore.data[key]; !exists {
-				// Code is unique in memory, use it
-				memStore.data[key] = originalURL
-				memStore.Unlock()
-				return code, nil
-			}
-			memStore.Unlock()
-			// if exists, loop to try another code
+// redirectETag derives a validator for a redirect response from the
+// mapping's destination and last-update time, so PATCH /api/urls/{code}
+// (which changes one or both) naturally invalidates it.
+func redirectETag(rec *storage.Record) string {
+	sum := sha256.Sum256([]byte(rec.OriginalURL + "|" + rec.UpdatedAt.UTC().Format(time.RFC3339Nano)))
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// handleStats handles GET /stats/{code} requests, returning click
+// analytics for the short code as JSON.
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code := strings.TrimPrefix(r.URL.Path, "/stats/")
+	if !shortCodePattern.MatchString("/" + code) {
+		http.NotFound(w, r)
+		return
+	}
+	domain := domainFromHost(r.Host)
+
+	stats, err := clickRecorder.Stats(r.Context(), domain, code)
+	if err != nil {
+		if errors.Is(err, analytics.ErrNotSupported) {
+			http.Error(w, "Not Implemented: click stats require STORAGE_DRIVER=mysql", http.StatusNotImplemented)
+		} else {
+			log.Println("Error retrieving stats for code", code, ":", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
-		return "", fmt.Errorf("could not generate a unique code after several attempts")
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
 
-	// Use database
-	for attempt := 0; attempt < 5; attempt++ {
-		code := generateCode(9)
-		// Try to insert the new mapping
-		_, err := db.Exec(
-			"INSERT INTO shortened_urls(domain, code, original_url) VALUES (?, ?, ?)",
-			domain, code, originalURL,
-		)
-		if err == nil {
-			// Successfully inserted, now update cache (if available) for quick future lookup
-			if redisClient != nil {
-				cacheKey := fmt.Sprintf("short:%s:%s", domain, code)
-				// No expiration (0 = keep until evicted), since link is permanent
-				if err := redisClient.Set(context.Background(), cacheKey, originalURL, 0).Err(); err != nil {
-					log.Println("Warning: failed to set Redis cache for", cacheKey, ":", err)
-				}
+// handleURLManage handles GET, PATCH and DELETE /api/urls/{code}, gated behind
+// auth.RequireAPIKey in main().
+func handleURLManage(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/api/urls/")
+	if !shortCodePattern.MatchString("/" + code) {
+		http.NotFound(w, r)
+		return
+	}
+	domain := domainFromHost(r.Host)
+
+	switch r.Method {
+	case http.MethodGet:
+		rec, err := getOriginalURL(domain, code)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.NotFound(w, r)
+			} else {
+				log.Println("Error retrieving URL for code", code, ":", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
-			return code, nil
+			return
 		}
-		// If code collision (duplicate key), generate a new code and retry
-		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
-			continue // duplicate entry for unique index, try another code
+		resp := struct {
+			Code         string     `json:"code"`
+			URL          string     `json:"url"`
+			ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+			RedirectType string     `json:"redirectType"`
+			Clicks       int64      `json:"clicks"`
+		}{Code: code, URL: rec.OriginalURL, ExpiresAt: rec.ExpiresAt, RedirectType: rec.RedirectType, Clicks: rec.Clicks}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+	case http.MethodDelete:
+		if err := deleteURLMapping(domain, code); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.NotFound(w, r)
+			} else {
+				log.Println("Error deleting URL mapping for code", code, ":", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPatch:
+		var req updateURLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
 		}
-		// Other errors (e.g., DB unavailable)
+		if req.URL == "" {
+			http.Error(w, "Bad Request: 'url' is required", http.StatusBadRequest)
+			return
+		}
+		if req.RedirectType != "" && req.RedirectType != redirectTemporary && req.RedirectType != redirectPermanent {
+			http.Error(w, "Bad Request: 'redirectType' must be 'permanent' or 'temporary'", http.StatusBadRequest)
+			return
+		}
+
+		rec, err := updateURLMapping(domain, code, req.URL, req.RedirectType)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				http.NotFound(w, r)
+			} else {
+				log.Println("Error updating URL mapping for code", code, ":", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		purgeCDN(shortURLFor(domain, code))
+
+		resp := struct {
+			Code         string `json:"code"`
+			URL          string `json:"url"`
+			RedirectType string `json:"redirectType"`
+		}{Code: code, URL: rec.OriginalURL, RedirectType: rec.RedirectType}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// rateLimitKey identifies the caller for /newurl rate limiting: the
+// presented API key if any (even though /newurl itself doesn't require
+// one), otherwise the client IP.
+func rateLimitKey(r *http.Request) string {
+	if token := auth.BearerToken(r); token != "" {
+		return "key:" + auth.HashToken(token)
+	}
+	return "ip:" + clientIP(r)
+}
+
+// domainFromHost normalizes an HTTP Host header into the domain used as
+// the storage/cache key (lowercased, port stripped).
+func domainFromHost(host string) string {
+	domain := strings.ToLower(host)
+	if idx := strings.Index(domain, ":"); idx != -1 {
+		domain = domain[:idx] // remove port if present (e.g., "localhost:8080" -> "localhost")
+	}
+	return domain
+}
+
+// clientIP extracts the caller's IP address, preferring the first hop
+// recorded in X-Forwarded-For (set by load balancers/proxies) and
+// falling back to the direct connection's RemoteAddr.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		if ip := strings.TrimSpace(strings.Split(fwd, ",")[0]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// shortURLFor builds the full shortened URL for a domain/code pair,
+// using http for localhost/IP domains since those are assumed to be dev
+// environments without TLS.
+func shortURLFor(domain, code string) string {
+	scheme := "https://"
+	if strings.Contains(domain, "localhost") || strings.Contains(domain, "127.0.0.1") {
+		scheme = "http://"
+	}
+	return fmt.Sprintf("%s%s/%s", scheme, domain, code)
+}
+
+// codeSourceFor returns the codec.Source used to mint short codes for
+// domain. The MySQL source is a process-wide singleton shared by every
+// domain; Redis sources (counter key shortener:seq:{domain}) and the
+// in-process fallback are created once per domain.
+func codeSourceFor(domain string) codec.Source {
+	if mysqlSeqSource != nil {
+		return mysqlSeqSource
+	}
+	domainSeqMu.Lock()
+	defer domainSeqMu.Unlock()
+	if src, ok := domainSeqSrc[domain]; ok {
+		return src
+	}
+	var src codec.Source
+	if redisSeqClient != nil {
+		src = codec.NewRedisSource(redisSeqClient, fmt.Sprintf("shortener:seq:%s", domain), redisSeqBatch)
+	} else {
+		src = codec.NewMemorySource()
+	}
+	domainSeqSrc[domain] = src
+	return src
+}
+
+// codeSpace is 62^9, the number of distinct 9-character base62 codes.
+const codeSpace = 13537086546263552
+
+// nextCode allocates the next ID for domain and base62-encodes it (with
+// bit-scrambling so sequential IDs don't produce visibly sequential
+// codes) into a code of the same length as shortCodePattern expects.
+// Scramble permutes 54 bits but codeSpace < 2^54, so a scrambled value
+// at or above codeSpace is scrambled again (cycle-walking) until it
+// fits; Encode would otherwise wrap it onto another ID's code. This
+// keeps codes distinct for every ID below codeSpace.
+func nextCode(ctx context.Context, domain string) (string, error) {
+	id, err := codeSourceFor(domain).Next(ctx)
+	if err != nil {
 		return "", err
 	}
-	// If we exit loop, we failed to find a unique code after several tries (extremely unlikely)
-	return "", fmt.Errorf("failed to generate unique code (too many collisions)")
+	s := codec.Scramble(id)
+	for id < codeSpace && s >= codeSpace {
+		s = codec.Scramble(s)
+	}
+	return codec.Encode(s), nil
 }
 
-// getOriginalURL retrieves the original URL for a given domain and short code.
-// It first checks Redis cache, then falls back to MySQL if not found in cache.
-func getOriginalURL(domain, code string) (string, error) {
-	if useMemory {
-		// Lookup from in-memory store
-		key := domain + ":" + code
-		memStore.RLock()
-		orig, exists := memStore.data[key]
-		memStore.RUnlock()
-		if !exists {
-			return "", sql.ErrNoRows
+// saveURLMapping reserves a short code for the given URL and stores the
+// mapping (plus any optional alias/expiry/password from opts) via store.
+// If opts.Alias is set it is used as the code instead of minting one; a
+// collision with an existing alias returns errAliasTaken. Returns the
+// short code.
+func saveURLMapping(domain, originalURL string, opts urlOptions) (string, error) {
+	ctx := context.Background()
+
+	if opts.RedirectType == "" {
+		opts.RedirectType = redirectTemporary
+	}
+	rec := storage.Record{
+		OriginalURL:  originalURL,
+		ExpiresAt:    opts.ExpiresAt,
+		PasswordHash: opts.PasswordHash,
+		RedirectType: opts.RedirectType,
+		UpdatedAt:    time.Now(),
+	}
+
+	if opts.Alias != "" {
+		if err := store.Insert(ctx, domain, opts.Alias, rec); err != nil {
+			if errors.Is(err, storage.ErrConflict) {
+				return "", errAliasTaken
+			}
+			return "", err
+		}
+		cacheURLRecord(ctx, domain, opts.Alias, rec)
+		return opts.Alias, nil
+	}
+
+	// A generated code is unique by construction against other generated
+	// codes, but a caller-supplied alias can occupy a slot the sequence
+	// only reaches later; when that happens, mint a fresh code and retry
+	// rather than fail the request.
+	for attempt := 0; attempt < maxCodeInsertAttempts; attempt++ {
+		code, err := nextCode(ctx, domain)
+		if err != nil {
+			return "", fmt.Errorf("failed to allocate short code: %w", err)
 		}
-		return orig, nil
+		if err := store.Insert(ctx, domain, code, rec); err != nil {
+			if errors.Is(err, storage.ErrConflict) {
+				continue
+			}
+			return "", err
+		}
+		cacheURLRecord(ctx, domain, code, rec)
+		return code, nil
 	}
+	return "", fmt.Errorf("failed to allocate a unique short code after %d attempts", maxCodeInsertAttempts)
+}
 
+// getOriginalURL retrieves the stored mapping for a given domain and
+// short code. It first checks Redis cache, then falls back to store if
+// not found in cache. Password-protected or already-expired links are
+// never cached, so a bare cache hit can't be used to bypass a password
+// check.
+func getOriginalURL(domain, code string) (*storage.Record, error) {
 	// Try cache first
 	cacheKey := fmt.Sprintf("short:%s:%s", domain, code)
-	if redisClient != nil {
-		val, err := redisClient.Get(context.Background(), cacheKey).Result()
+	if redisCache != nil {
+		val, err := redisCache.Get(context.Background(), cacheKey)
 		if err == nil {
-			return val, nil // cache hit
-		}
-		if err != redis.Nil {
+			var rec storage.Record
+			if jsonErr := json.Unmarshal([]byte(val), &rec); jsonErr == nil {
+				return &rec, nil // cache hit; only password-free, unexpired links are ever put here
+			}
+			log.Println("Warning: discarding malformed cache entry for", cacheKey)
+		} else if err != cache.ErrNotFound {
 			// An unexpected error occurred with Redis (connection issue, etc.)
 			log.Println("Redis GET error for", cacheKey, ":", err)
 		}
-		// cache miss (or error), proceed to DB
+		// cache miss (or error), proceed to the store
 	}
 
-	// Query the database for the mapping
-	var originalURL string
-	err := db.QueryRow(
-		"SELECT original_url FROM shortened_urls WHERE domain = ? AND code = ?",
-		domain, code,
-	).Scan(&originalURL)
+	rec, err := store.Lookup(context.Background(), domain, code)
 	if err != nil {
-		return "", err // could be sql.ErrNoRows or a connection error
+		return nil, err // could be storage.ErrNotFound or a connection error
 	}
 
-	// Populate cache for next time (if cache is enabled)
-	if redisClient != nil {
-		if err := redisClient.Set(context.Background(), cacheKey, originalURL, 0).Err(); err != nil {
-			log.Println("Warning: failed to update Redis cache for", cacheKey, ":", err)
+	cacheURLRecord(context.Background(), domain, code, *rec)
+	return rec, nil
+}
+
+// cachedFields is the subset of storage.Record stored in Redis:
+// OriginalURL, RedirectType and UpdatedAt are needed to serve a redirect
+// straight from cache (including its ETag/Last-Modified), but
+// ExpiresAt/PasswordHash never reach the cache at all (see
+// cacheURLRecord) and Clicks is tracked directly in the store.
+type cachedFields struct {
+	OriginalURL  string    `json:"originalUrl"`
+	RedirectType string    `json:"redirectType"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// cacheURLRecord populates the Redis cache for a freshly saved or
+// looked-up mapping, unless it's password-protected (caching the plain
+// URL would let a cache hit skip the password check) or already expired.
+// The cache entry's TTL tracks ExpiresAt so it never outlives the row.
+func cacheURLRecord(ctx context.Context, domain, code string, rec storage.Record) {
+	if redisCache == nil || rec.PasswordHash != "" {
+		return
+	}
+	ttl := time.Duration(0)
+	if rec.ExpiresAt != nil {
+		ttl = time.Until(*rec.ExpiresAt)
+		if ttl <= 0 {
+			return
 		}
 	}
-	return originalURL, nil
+	payload, err := json.Marshal(cachedFields{OriginalURL: rec.OriginalURL, RedirectType: rec.RedirectType, UpdatedAt: rec.UpdatedAt})
+	if err != nil {
+		log.Println("Warning: failed to marshal cache entry for", domain, code, ":", err)
+		return
+	}
+	cacheKey := fmt.Sprintf("short:%s:%s", domain, code)
+	if err := redisCache.Set(ctx, cacheKey, string(payload), ttl); err != nil {
+		log.Println("Warning: failed to set Redis cache for", cacheKey, ":", err)
+	}
 }
 
-// generateCode produces a random string of the given length using the allowed characters [0-9A-Za-z].
-func generateCode(length int) string {
-	const charSet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	// Use crypto/rand for secure random bytes
-	for i := 0; i < length; i++ {
-		// We generate random bytes and use modulo to pick a char from charSet.
-		// To reduce modulo bias, we discard values  >= 248 (which would cause bias since 248 mod 62 < 62*4).
-		for {
-			rb := make([]byte, 1)
-			_, err := rand.Read(rb)
-			if err != nil {
-				// If cryptographic randomness fails, fallback to time-based (this is very unlikely)
-				rb[0] = byte(time.Now().UnixNano() % 256)
-			}
-			// 62 * 4 = 248. If rb[0] < 248, we can use it directly.
-			if rb[0] < byte(len(charSet))*4 {
-				b[i] = charSet[int(rb[0])%len(charSet)]
-				break
-			}
-			// otherwise, loop again to avoid bias
+// updateURLMapping retargets an existing mapping's destination URL (and
+// optionally its redirect type), invalidating the cache entry so the new
+// destination takes effect immediately. It returns storage.ErrNotFound
+// if no such mapping exists.
+func updateURLMapping(domain, code, newURL, redirectType string) (*storage.Record, error) {
+	ctx := context.Background()
+	rec, err := store.Update(ctx, domain, code, newURL, redirectType, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if redisCache != nil {
+		cacheKey := fmt.Sprintf("short:%s:%s", domain, code)
+		if err := redisCache.Del(ctx, cacheKey); err != nil {
+			log.Println("Warning: failed to invalidate Redis cache for", cacheKey, ":", err)
+		}
+	}
+
+	return rec, nil
+}
+
+// purgeCDN best-effort notifies the edge CDN configured via
+// CDN_PURGE_URL that shortURL's cached response is stale. It's a no-op
+// if CDN_PURGE_URL wasn't set; failures are logged, not returned, since a
+// missed purge only costs a slightly longer CDN TTL, not correctness.
+func purgeCDN(shortURL string) {
+	if cdnPurgeURL == "" {
+		return
+	}
+	body, err := json.Marshal(struct {
+		URL string `json:"url"`
+	}{URL: shortURL})
+	if err != nil {
+		log.Println("Warning: failed to marshal CDN purge payload for", shortURL, ":", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, cdnPurgeURL, bytes.NewReader(body))
+	if err != nil {
+		log.Println("Warning: failed to build CDN purge request for", shortURL, ":", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := purgeClient.Do(req)
+	if err != nil {
+		log.Println("Warning: CDN purge request failed for", shortURL, ":", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Println("Warning: CDN purge for", shortURL, "returned status", resp.Status)
+	}
+}
+
+// deleteURLMapping removes the mapping for domain/code, invalidating any
+// cached entry. It returns storage.ErrNotFound if no such mapping existed.
+func deleteURLMapping(domain, code string) error {
+	ctx := context.Background()
+	if err := store.Delete(ctx, domain, code); err != nil {
+		return err
+	}
+
+	if redisCache != nil {
+		cacheKey := fmt.Sprintf("short:%s:%s", domain, code)
+		if err := redisCache.Del(ctx, cacheKey); err != nil {
+			log.Println("Warning: failed to invalidate Redis cache for", cacheKey, ":", err)
 		}
 	}
-	return string(b)
+	return nil
 }
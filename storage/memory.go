@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store backed by a map, used when no
+// database is configured.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string]Record // maps "domain:code" -> record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string]Record)}
+}
+
+func memoryKey(domain, code string) string {
+	return domain + ":" + code
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, domain, code string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memoryKey(domain, code)
+	if _, exists := s.data[key]; exists {
+		return ErrConflict
+	}
+	s.data[key] = rec
+	return nil
+}
+
+func (s *MemoryStore) Lookup(ctx context.Context, domain, code string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, exists := s.data[memoryKey(domain, code)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &rec, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, domain, code, originalURL, redirectType string, updatedAt time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memoryKey(domain, code)
+	rec, exists := s.data[key]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	rec.OriginalURL = originalURL
+	if redirectType != "" {
+		rec.RedirectType = redirectType
+	}
+	rec.UpdatedAt = updatedAt
+	s.data[key] = rec
+	return &rec, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, domain, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memoryKey(domain, code)
+	if _, exists := s.data[key]; !exists {
+		return ErrNotFound
+	}
+	delete(s.data, key)
+	return nil
+}
+
+func (s *MemoryStore) IncrementClicks(ctx context.Context, domain, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memoryKey(domain, code)
+	rec, exists := s.data[key]
+	if !exists {
+		return ErrNotFound
+	}
+	rec.Clicks++
+	s.data[key] = rec
+	return nil
+}
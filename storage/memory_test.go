@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreInsertLookup(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	rec := Record{OriginalURL: "https://example.com", RedirectType: "temporary", UpdatedAt: time.Now()}
+
+	if err := s.Insert(ctx, "example.com", "abc123xyz", rec); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	got, err := s.Lookup(ctx, "example.com", "abc123xyz")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if got.OriginalURL != rec.OriginalURL {
+		t.Errorf("Lookup OriginalURL = %q, want %q", got.OriginalURL, rec.OriginalURL)
+	}
+}
+
+func TestMemoryStoreInsertConflict(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	rec := Record{OriginalURL: "https://example.com"}
+
+	if err := s.Insert(ctx, "example.com", "abc123xyz", rec); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	err := s.Insert(ctx, "example.com", "abc123xyz", rec)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("second Insert with same domain/code = %v, want ErrConflict", err)
+	}
+}
+
+func TestMemoryStoreLookupNotFound(t *testing.T) {
+	s := NewMemoryStore()
+	if _, err := s.Lookup(context.Background(), "example.com", "missing12"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup of missing mapping = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreUpdate(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	rec := Record{OriginalURL: "https://old.example.com", RedirectType: "temporary"}
+	if err := s.Insert(ctx, "example.com", "abc123xyz", rec); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	updated, err := s.Update(ctx, "example.com", "abc123xyz", "https://new.example.com", "permanent", time.Unix(100, 0))
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.OriginalURL != "https://new.example.com" || updated.RedirectType != "permanent" {
+		t.Errorf("Update result = %+v, want original_url/redirect_type updated", updated)
+	}
+
+	// An empty redirectType leaves the existing value alone.
+	updated, err = s.Update(ctx, "example.com", "abc123xyz", "https://third.example.com", "", time.Unix(200, 0))
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.RedirectType != "permanent" {
+		t.Errorf("Update with empty redirectType changed it to %q, want unchanged \"permanent\"", updated.RedirectType)
+	}
+}
+
+func TestMemoryStoreUpdateNotFound(t *testing.T) {
+	s := NewMemoryStore()
+	if _, err := s.Update(context.Background(), "example.com", "missing12", "https://x", "", time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of missing mapping = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	if err := s.Insert(ctx, "example.com", "abc123xyz", Record{OriginalURL: "https://example.com"}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := s.Delete(ctx, "example.com", "abc123xyz"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Lookup(ctx, "example.com", "abc123xyz"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreDeleteNotFound(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.Delete(context.Background(), "example.com", "missing12"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of missing mapping = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreIncrementClicks(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	if err := s.Insert(ctx, "example.com", "abc123xyz", Record{OriginalURL: "https://example.com"}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.IncrementClicks(ctx, "example.com", "abc123xyz"); err != nil {
+			t.Fatalf("IncrementClicks: %v", err)
+		}
+	}
+	rec, err := s.Lookup(ctx, "example.com", "abc123xyz")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if rec.Clicks != 3 {
+		t.Errorf("Clicks = %d, want 3", rec.Clicks)
+	}
+}
+
+func TestMemoryStoreIncrementClicksNotFound(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.IncrementClicks(context.Background(), "example.com", "missing12"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("IncrementClicks of missing mapping = %v, want ErrNotFound", err)
+	}
+}
+
+// TestMemoryStoreDomainIsolation checks that the same code under
+// different domains is tracked independently, since the cache/store key
+// is "domain:code", not "code" alone.
+func TestMemoryStoreDomainIsolation(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	if err := s.Insert(ctx, "a.example.com", "abc123xyz", Record{OriginalURL: "https://a.example.com"}); err != nil {
+		t.Fatalf("Insert a.example.com: %v", err)
+	}
+	if err := s.Insert(ctx, "b.example.com", "abc123xyz", Record{OriginalURL: "https://b.example.com"}); err != nil {
+		t.Fatalf("Insert b.example.com: %v", err)
+	}
+	a, err := s.Lookup(ctx, "a.example.com", "abc123xyz")
+	if err != nil {
+		t.Fatalf("Lookup a.example.com: %v", err)
+	}
+	if a.OriginalURL != "https://a.example.com" {
+		t.Errorf("a.example.com mapping = %q, want https://a.example.com", a.OriginalURL)
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQLStore is a Store backed by a MySQL shortened_urls table.
+type MySQLStore struct {
+	db *sql.DB
+}
+
+// NewMySQLStore wraps db, creating the shortened_urls table if it
+// doesn't already exist.
+func NewMySQLStore(db *sql.DB) (*MySQLStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS shortened_urls (
+        id BIGINT AUTO_INCREMENT PRIMARY KEY,
+        domain VARCHAR(255) NOT NULL,
+        code VARCHAR(9) NOT NULL,
+        original_url TEXT NOT NULL,
+        expires_at DATETIME NULL,
+        password_hash VARCHAR(255) NOT NULL DEFAULT '',
+        redirect_type ENUM('permanent', 'temporary') NOT NULL DEFAULT 'temporary',
+        updated_at DATETIME NOT NULL,
+        clicks BIGINT NOT NULL DEFAULT 0,
+        UNIQUE KEY unique_domain_code (domain, code)
+    ) ENGINE=InnoDB;`)
+	if err != nil {
+		return nil, err
+	}
+	return &MySQLStore{db: db}, nil
+}
+
+func (s *MySQLStore) Insert(ctx context.Context, domain, code string, rec Record) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO shortened_urls(domain, code, original_url, expires_at, password_hash, redirect_type, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		domain, code, rec.OriginalURL, rec.ExpiresAt, rec.PasswordHash, rec.RedirectType, rec.UpdatedAt,
+	)
+	if err != nil {
+		if isDuplicateKeyErr(err) {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLStore) Lookup(ctx context.Context, domain, code string) (*Record, error) {
+	var rec Record
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		"SELECT original_url, expires_at, password_hash, redirect_type, updated_at, clicks FROM shortened_urls WHERE domain = ? AND code = ?",
+		domain, code,
+	).Scan(&rec.OriginalURL, &expiresAt, &rec.PasswordHash, &rec.RedirectType, &rec.UpdatedAt, &rec.Clicks)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		rec.ExpiresAt = &expiresAt.Time
+	}
+	return &rec, nil
+}
+
+// Update issues the UPDATE and then re-reads the row via Lookup to
+// determine whether it exists, rather than trusting RowsAffected: MySQL
+// reports rows matched-and-changed, not rows matched, so a retarget to
+// the URL the link already points to (an idempotent client retry) would
+// affect 0 rows despite the mapping existing.
+func (s *MySQLStore) Update(ctx context.Context, domain, code, originalURL, redirectType string, updatedAt time.Time) (*Record, error) {
+	var err error
+	if redirectType != "" {
+		_, err = s.db.ExecContext(ctx,
+			"UPDATE shortened_urls SET original_url = ?, redirect_type = ?, updated_at = ? WHERE domain = ? AND code = ?",
+			originalURL, redirectType, updatedAt, domain, code,
+		)
+	} else {
+		_, err = s.db.ExecContext(ctx,
+			"UPDATE shortened_urls SET original_url = ?, updated_at = ? WHERE domain = ? AND code = ?",
+			originalURL, updatedAt, domain, code,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Lookup(ctx, domain, code)
+}
+
+func (s *MySQLStore) Delete(ctx context.Context, domain, code string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM shortened_urls WHERE domain = ? AND code = ?", domain, code)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MySQLStore) IncrementClicks(ctx context.Context, domain, code string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE shortened_urls SET clicks = clicks + 1 WHERE domain = ? AND code = ?", domain, code)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// isDuplicateKeyErr reports whether err is a MySQL duplicate-entry error
+// (1062), e.g. from a caller-supplied alias colliding with an existing
+// code.
+func isDuplicateKeyErr(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
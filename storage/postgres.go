@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgresStore is a Store backed by a PostgreSQL shortened_urls table,
+// using lib/pq. PostgreSQL has no MySQL-style duplicate-key error to
+// sniff, so Insert relies on ON CONFLICT DO NOTHING and checks
+// RowsAffected instead.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore wraps db, creating the shortened_urls table if it
+// doesn't already exist.
+func NewPostgresStore(db *sql.DB) (*PostgresStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS shortened_urls (
+        id BIGSERIAL PRIMARY KEY,
+        domain VARCHAR(255) NOT NULL,
+        code VARCHAR(9) NOT NULL,
+        original_url TEXT NOT NULL,
+        expires_at TIMESTAMP NULL,
+        password_hash VARCHAR(255) NOT NULL DEFAULT '',
+        redirect_type VARCHAR(9) NOT NULL DEFAULT 'temporary',
+        updated_at TIMESTAMP NOT NULL,
+        clicks BIGINT NOT NULL DEFAULT 0,
+        UNIQUE (domain, code)
+    );`)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Insert(ctx context.Context, domain, code string, rec Record) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO shortened_urls(domain, code, original_url, expires_at, password_hash, redirect_type, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (domain, code) DO NOTHING`,
+		domain, code, rec.OriginalURL, rec.ExpiresAt, rec.PasswordHash, rec.RedirectType, rec.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *PostgresStore) Lookup(ctx context.Context, domain, code string) (*Record, error) {
+	var rec Record
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		"SELECT original_url, expires_at, password_hash, redirect_type, updated_at, clicks FROM shortened_urls WHERE domain = $1 AND code = $2",
+		domain, code,
+	).Scan(&rec.OriginalURL, &expiresAt, &rec.PasswordHash, &rec.RedirectType, &rec.UpdatedAt, &rec.Clicks)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		rec.ExpiresAt = &expiresAt.Time
+	}
+	return &rec, nil
+}
+
+// Update issues the UPDATE and then re-reads the row via Lookup to
+// determine whether it exists, rather than trusting RowsAffected: if the
+// row's values are already identical to the new ones (e.g. an idempotent
+// client retry), Postgres reports 0 rows affected despite the mapping
+// existing.
+func (s *PostgresStore) Update(ctx context.Context, domain, code, originalURL, redirectType string, updatedAt time.Time) (*Record, error) {
+	var err error
+	if redirectType != "" {
+		_, err = s.db.ExecContext(ctx,
+			"UPDATE shortened_urls SET original_url = $1, redirect_type = $2, updated_at = $3 WHERE domain = $4 AND code = $5",
+			originalURL, redirectType, updatedAt, domain, code,
+		)
+	} else {
+		_, err = s.db.ExecContext(ctx,
+			"UPDATE shortened_urls SET original_url = $1, updated_at = $2 WHERE domain = $3 AND code = $4",
+			originalURL, updatedAt, domain, code,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Lookup(ctx, domain, code)
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, domain, code string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM shortened_urls WHERE domain = $1 AND code = $2", domain, code)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) IncrementClicks(ctx context.Context, domain, code string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE shortened_urls SET clicks = clicks + 1 WHERE domain = $1 AND code = $2", domain, code)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package storage abstracts persistence for short URL mappings behind a
+// single Store interface, so the HTTP layer doesn't need to know
+// whether mappings live in MySQL, PostgreSQL, or an in-process map.
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Lookup, Update, Delete, and IncrementClicks
+// when no mapping exists for the given domain/code.
+var ErrNotFound = errors.New("storage: mapping not found")
+
+// ErrConflict is returned by Insert when domain/code is already in use.
+// Generated codes are unique by construction and never hit this path;
+// it's reserved for caller-supplied alias collisions.
+var ErrConflict = errors.New("storage: domain/code already in use")
+
+// Record is a stored short URL mapping.
+type Record struct {
+	OriginalURL  string
+	ExpiresAt    *time.Time
+	PasswordHash string
+	RedirectType string
+	UpdatedAt    time.Time
+	Clicks       int64
+}
+
+// Store persists short URL mappings. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Insert creates a new mapping for domain/code. It returns
+	// ErrConflict if one already exists.
+	Insert(ctx context.Context, domain, code string, rec Record) error
+	// Lookup returns the mapping for domain/code, or ErrNotFound.
+	Lookup(ctx context.Context, domain, code string) (*Record, error)
+	// Update retargets an existing mapping's destination URL and, if
+	// redirectType is non-empty, its redirect type, setting UpdatedAt
+	// to updatedAt. Returns ErrNotFound if no mapping exists.
+	Update(ctx context.Context, domain, code, originalURL, redirectType string, updatedAt time.Time) (*Record, error)
+	// Delete removes the mapping for domain/code, or returns
+	// ErrNotFound.
+	Delete(ctx context.Context, domain, code string) error
+	// IncrementClicks atomically bumps the mapping's click counter, a
+	// lightweight running total kept independently of the analytics
+	// package's detailed per-click event log.
+	IncrementClicks(ctx context.Context, domain, code string) error
+}